@@ -0,0 +1,44 @@
+package pqtest
+
+import "context"
+
+// A Backend provides the control connection Open uses to create and
+// garbage collect test databases. Acquire returns a connection string
+// for a running, reachable Postgres server, plus a cleanup function
+// releasing whatever resources it allocated to provide it.
+//
+// Acquire may be called many times over the life of a test binary, so
+// a Backend that provisions a shared resource, like a Docker
+// container, should memoize: the first call does the real work, and
+// later calls cheaply return the same connection string. pqtest
+// itself never calls the returned cleanup, since a Backend is
+// typically shared across many calls to Open; callers that want the
+// resource torn down should hold onto the Backend (commonly in
+// TestMain) and call cleanup themselves once they're done with it.
+type Backend interface {
+	Acquire(ctx context.Context) (adminURL string, cleanup func(), err error)
+}
+
+// WithBackend returns an Option that selects the Backend used to
+// obtain the control connection for Open, instead of connecting
+// directly to whatever DatabaseURL (or FromEnv) points at.
+func WithBackend(b Backend) Option {
+	return optionFn(func(f Fataler, data *optionData) {
+		data.backend = b
+	})
+}
+
+// resolveAdminURL returns the control connection string Open should
+// use: the configured Backend's, if one was given via WithBackend, or
+// data.databaseURL itself otherwise - the original pqtest behavior of
+// connecting straight to an already-running Postgres server.
+func resolveAdminURL(ctx context.Context, f Fataler, data *optionData) string {
+	if data.backend == nil {
+		return data.databaseURL
+	}
+	adminURL, _, err := data.backend.Acquire(ctx)
+	if err != nil {
+		f.Fatal(err)
+	}
+	return adminURL
+}
@@ -0,0 +1,124 @@
+package pqtest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// EmbeddedBackend is a Backend that starts a throwaway Postgres
+// server using the initdb and pg_ctl binaries found on PATH, on a
+// random free port, for the lifetime of the process. It lets CI runs
+// work without any pre-provisioned Postgres, at the cost of a slower
+// first Open while the server initializes.
+type EmbeddedBackend struct {
+	// ReadyTimeout bounds how long Acquire waits for the server to
+	// start accepting connections. Defaults to 30s.
+	ReadyTimeout time.Duration
+
+	once     sync.Once
+	adminURL string
+	dataDir  string
+	err      error
+}
+
+// Acquire starts the embedded server on first call and returns its
+// connection string on every call; later calls are cheap.
+func (b *EmbeddedBackend) Acquire(ctx context.Context) (string, func(), error) {
+	b.once.Do(func() { b.start(ctx) })
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	return b.adminURL, b.stop, nil
+}
+
+func (b *EmbeddedBackend) start(ctx context.Context) {
+	dataDir, err := ioutil.TempDir("", "pqtest-embedded-")
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.dataDir = dataDir
+
+	port, err := freePort()
+	if err != nil {
+		b.err = err
+		return
+	}
+
+	if out, err := exec.CommandContext(ctx, "initdb", "-D", dataDir, "-U", "postgres", "-A", "trust").CombinedOutput(); err != nil {
+		b.err = fmt.Errorf("pqtest: initdb: %w: %s", err, out)
+		return
+	}
+
+	logPath := filepath.Join(dataDir, "server.log")
+	startArgs := []string{
+		"-D", dataDir,
+		"-w",
+		"-l", logPath,
+		"-o", fmt.Sprintf("-p %d -h 127.0.0.1", port),
+		"start",
+	}
+	if out, err := exec.CommandContext(ctx, "pg_ctl", startArgs...).CombinedOutput(); err != nil {
+		b.err = fmt.Errorf("pqtest: pg_ctl start: %w: %s", err, out)
+		return
+	}
+
+	adminURL := fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port)
+	timeout := b.ReadyTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	if err := waitForReady(adminURL, timeout); err != nil {
+		b.err = err
+		return
+	}
+	b.adminURL = adminURL
+}
+
+func (b *EmbeddedBackend) stop() {
+	if b.dataDir == "" {
+		return
+	}
+	exec.Command("pg_ctl", "-D", b.dataDir, "-m", "fast", "stop").Run()
+	os.RemoveAll(b.dataDir)
+}
+
+// freePort asks the kernel for a free TCP port by briefly listening
+// on port 0.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitForReady polls adminURL until it accepts connections or timeout
+// elapses.
+func waitForReady(adminURL string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		db, err := sql.Open("postgres", adminURL)
+		if err == nil {
+			lastErr = db.Ping()
+			db.Close()
+			if lastErr == nil {
+				return nil
+			}
+		} else {
+			lastErr = err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("pqtest: server did not become ready within %s: %w", timeout, lastErr)
+}
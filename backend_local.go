@@ -0,0 +1,19 @@
+package pqtest
+
+import "context"
+
+// LocalBackend is a Backend that connects to an already-running
+// Postgres server at URL. It's the behavior Open has always had when
+// no WithBackend Option is given; it exists as an explicit Backend so
+// it can be swapped in and out alongside EmbeddedBackend and
+// DockerBackend, e.g. to fall back to a developer's local Postgres
+// outside of CI.
+type LocalBackend struct {
+	URL string
+}
+
+// Acquire returns b.URL unchanged; there's nothing to provision or
+// tear down.
+func (b LocalBackend) Acquire(ctx context.Context) (string, func(), error) {
+	return b.URL, func() {}, nil
+}
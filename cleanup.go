@@ -0,0 +1,104 @@
+package pqtest
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// A cleanuper can register a function to run when the test or
+// benchmark using it completes, as implemented by *testing.T and
+// *testing.B's Cleanup method.
+type cleanuper interface {
+	Cleanup(func())
+}
+
+// A failer reports whether the test or benchmark using it has
+// already failed, as implemented by *testing.T and *testing.B's
+// Failed method.
+type failer interface {
+	Failed() bool
+}
+
+// A logger logs a formatted message without failing the test, as
+// implemented by *testing.T and *testing.B's Logf method.
+type logger interface {
+	Logf(string, ...interface{})
+}
+
+// KeepOnFailure returns an Option that skips dropping the test
+// database if the test has already failed by the time its Cleanup
+// runs, so a developer can connect to it and inspect state
+// post-mortem. It has no effect unless f implements both Cleanup and
+// Failed, as *testing.T and *testing.B do.
+func KeepOnFailure() Option {
+	return optionFn(func(f Fataler, data *optionData) {
+		data.keepOnFailure = true
+	})
+}
+
+// SyncGC returns an Option that makes database cleanup - both the
+// per-test drop registered via Cleanup and the periodic sweep of
+// stale pqtest_* databases - wait for DROP DATABASE to complete
+// instead of firing it in a background goroutine. Background drops
+// can be killed when the test process exits, leaking databases in
+// CI; SyncGC trades a slower test for a guarantee that cleanup
+// finishes.
+func SyncGC() Option {
+	return optionFn(func(f Fataler, data *optionData) {
+		data.syncGC = true
+	})
+}
+
+// registerCleanup arranges for the database named name to be dropped
+// when f's test or benchmark finishes, if f supports Cleanup. close
+// is called first to release the caller's connection(s) to it, e.g.
+// (*sql.DB).Close or (*pgxpool.Pool).Close. adminURL is the control
+// connection used to issue the DROP DATABASE, as resolved by
+// resolveAdminURL.
+func registerCleanup(f Fataler, data *optionData, adminURL string, close func(), name string) {
+	c, ok := f.(cleanuper)
+	if !ok {
+		return
+	}
+	syncGC := data.syncGC
+	keepOnFailure := data.keepOnFailure
+
+	c.Cleanup(func() {
+		if keepOnFailure {
+			if fl, ok := f.(failer); ok && fl.Failed() {
+				return
+			}
+		}
+		close()
+
+		drop := func() error {
+			ctldb, err := sql.Open("postgres", adminURL)
+			if err != nil {
+				return err
+			}
+			defer ctldb.Close()
+			_, err = ctldb.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(name))
+			return err
+		}
+		if syncGC {
+			if err := drop(); err != nil {
+				f.Fatal(err)
+			}
+			return
+		}
+		go drop()
+	})
+}
+
+// logURL reports newDatabaseURL through f.Logf when f supports it, so
+// the URL only surfaces in verbose test output or on failure rather
+// than unconditionally on stdout.
+func logURL(f Fataler, newDatabaseURL string) {
+	if l, ok := f.(logger); ok {
+		l.Logf("%s", newDatabaseURL)
+		return
+	}
+	fmt.Println(newDatabaseURL)
+}
@@ -0,0 +1,231 @@
+package dbschema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// A Difference describes one structural disagreement between two
+// Schemas, in a form suitable for printing in a test failure.
+type Difference struct {
+	// Table is the table the difference concerns, or "" for a
+	// schema-wide difference such as a missing sequence.
+	Table       string
+	Description string
+}
+
+func (d Difference) String() string {
+	if d.Table == "" {
+		return d.Description
+	}
+	return fmt.Sprintf("%s: %s", d.Table, d.Description)
+}
+
+// Diff compares two Schemas and returns a Difference for every table,
+// column, index, foreign key, primary key, unique constraint or
+// sequence present in one but not the other, or present in both but
+// differing. An empty result means a and b are structurally
+// equivalent.
+func Diff(a, b *Schema) []Difference {
+	var diffs []Difference
+	diffs = append(diffs, diffStringSlices("", "tables", a.Tables, b.Tables)...)
+	diffs = append(diffs, diffStringSlices("", "sequences", a.Sequences, b.Sequences)...)
+
+	for _, table := range unionKeys(a.Tables, b.Tables) {
+		diffs = append(diffs, diffColumns(table, a.Columns[table], b.Columns[table])...)
+		diffs = append(diffs, diffIndexes(table, a.Indexes[table], b.Indexes[table])...)
+		diffs = append(diffs, diffForeignKeys(table, a.ForeignKeys[table], b.ForeignKeys[table])...)
+		diffs = append(diffs, diffOrderedColumns(table, "primary key", a.PrimaryKey[table], b.PrimaryKey[table])...)
+		diffs = append(diffs, diffUnique(table, a.Unique[table], b.Unique[table])...)
+	}
+	return diffs
+}
+
+func diffColumns(table string, a, b []Column) []Difference {
+	var diffs []Difference
+	byName := func(cols []Column) map[string]Column {
+		m := make(map[string]Column, len(cols))
+		for _, c := range cols {
+			m[c.Name] = c
+		}
+		return m
+	}
+	am, bm := byName(a), byName(b)
+	for _, name := range unionColumnNames(a, b) {
+		ac, aok := am[name]
+		bc, bok := bm[name]
+		switch {
+		case aok && !bok:
+			diffs = append(diffs, Difference{table, fmt.Sprintf("column %q missing from second schema", name)})
+		case !aok && bok:
+			diffs = append(diffs, Difference{table, fmt.Sprintf("column %q missing from first schema", name)})
+		case !reflect.DeepEqual(ac, bc):
+			diffs = append(diffs, Difference{table, fmt.Sprintf("column %q differs: %+v vs %+v", name, ac, bc)})
+		}
+	}
+	return diffs
+}
+
+func unionColumnNames(a, b []Column) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, c := range a {
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			names = append(names, c.Name)
+		}
+	}
+	for _, c := range b {
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			names = append(names, c.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func diffIndexes(table string, a, b []Index) []Difference {
+	var diffs []Difference
+	byName := func(idxs []Index) map[string]Index {
+		m := make(map[string]Index, len(idxs))
+		for _, i := range idxs {
+			m[i.Name] = i
+		}
+		return m
+	}
+	am, bm := byName(a), byName(b)
+	for _, name := range unionKeys(indexNames(a), indexNames(b)) {
+		ai, aok := am[name]
+		bi, bok := bm[name]
+		switch {
+		case aok && !bok:
+			diffs = append(diffs, Difference{table, fmt.Sprintf("index %q missing from second schema", name)})
+		case !aok && bok:
+			diffs = append(diffs, Difference{table, fmt.Sprintf("index %q missing from first schema", name)})
+		case !reflect.DeepEqual(ai, bi):
+			diffs = append(diffs, Difference{table, fmt.Sprintf("index %q differs: %+v vs %+v", name, ai, bi)})
+		}
+	}
+	return diffs
+}
+
+func indexNames(idxs []Index) []string {
+	names := make([]string, len(idxs))
+	for i, idx := range idxs {
+		names[i] = idx.Name
+	}
+	return names
+}
+
+func diffForeignKeys(table string, a, b []ForeignKey) []Difference {
+	var diffs []Difference
+	byName := func(fks []ForeignKey) map[string]ForeignKey {
+		m := make(map[string]ForeignKey, len(fks))
+		for _, fk := range fks {
+			m[fk.Name] = fk
+		}
+		return m
+	}
+	am, bm := byName(a), byName(b)
+	for _, name := range unionKeys(fkNames(a), fkNames(b)) {
+		af, aok := am[name]
+		bf, bok := bm[name]
+		switch {
+		case aok && !bok:
+			diffs = append(diffs, Difference{table, fmt.Sprintf("foreign key %q missing from second schema", name)})
+		case !aok && bok:
+			diffs = append(diffs, Difference{table, fmt.Sprintf("foreign key %q missing from first schema", name)})
+		case !reflect.DeepEqual(af, bf):
+			diffs = append(diffs, Difference{table, fmt.Sprintf("foreign key %q differs: %+v vs %+v", name, af, bf)})
+		}
+	}
+	return diffs
+}
+
+func fkNames(fks []ForeignKey) []string {
+	names := make([]string, len(fks))
+	for i, fk := range fks {
+		names[i] = fk.Name
+	}
+	return names
+}
+
+func diffUnique(table string, a, b [][]string) []Difference {
+	key := func(cols []string) string {
+		sorted := append([]string(nil), cols...)
+		sort.Strings(sorted)
+		return fmt.Sprint(sorted)
+	}
+	aSet := make(map[string]bool, len(a))
+	for _, cols := range a {
+		aSet[key(cols)] = true
+	}
+	bSet := make(map[string]bool, len(b))
+	for _, cols := range b {
+		bSet[key(cols)] = true
+	}
+
+	var diffs []Difference
+	for k := range aSet {
+		if !bSet[k] {
+			diffs = append(diffs, Difference{table, fmt.Sprintf("unique constraint on %s missing from second schema", k)})
+		}
+	}
+	for k := range bSet {
+		if !aSet[k] {
+			diffs = append(diffs, Difference{table, fmt.Sprintf("unique constraint on %s missing from first schema", k)})
+		}
+	}
+	return diffs
+}
+
+// diffOrderedColumns compares a and b as ordered column lists rather
+// than sets, so that a composite key whose column order changed -
+// (a, b) vs (b, a) - is reported as a difference even though both
+// sides reference the same columns.
+func diffOrderedColumns(table, what string, a, b []string) []Difference {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	return []Difference{{table, fmt.Sprintf("%s differs: %v vs %v", what, a, b)}}
+}
+
+func diffStringSlices(table, what string, a, b []string) []Difference {
+	aSet := toSet(a)
+	bSet := toSet(b)
+
+	var diffs []Difference
+	for _, name := range unionKeys(a, b) {
+		switch {
+		case aSet[name] && !bSet[name]:
+			diffs = append(diffs, Difference{table, fmt.Sprintf("%s %q missing from second schema", what, name)})
+		case !aSet[name] && bSet[name]:
+			diffs = append(diffs, Difference{table, fmt.Sprintf("%s %q missing from first schema", what, name)})
+		}
+	}
+	return diffs
+}
+
+func toSet(s []string) map[string]bool {
+	m := make(map[string]bool, len(s))
+	for _, v := range s {
+		m[v] = true
+	}
+	return m
+}
+
+// unionKeys returns the sorted, deduplicated union of a and b.
+func unionKeys(a, b []string) []string {
+	seen := toSet(a)
+	for _, v := range b {
+		seen[v] = true
+	}
+	names := make([]string, 0, len(seen))
+	for v := range seen {
+		names = append(names, v)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,158 @@
+package dbschema
+
+import "testing"
+
+func newSchema() *Schema {
+	return &Schema{
+		Columns:     make(map[string][]Column),
+		Indexes:     make(map[string][]Index),
+		ForeignKeys: make(map[string][]ForeignKey),
+		PrimaryKey:  make(map[string][]string),
+		Unique:      make(map[string][][]string),
+	}
+}
+
+func TestDiffNoDifferences(t *testing.T) {
+	a := newSchema()
+	a.Tables = []string{"users"}
+	a.Columns["users"] = []Column{{Name: "id", Type: "integer"}}
+	a.PrimaryKey["users"] = []string{"id"}
+
+	b := newSchema()
+	b.Tables = []string{"users"}
+	b.Columns["users"] = []Column{{Name: "id", Type: "integer"}}
+	b.PrimaryKey["users"] = []string{"id"}
+
+	if diffs := Diff(a, b); len(diffs) != 0 {
+		t.Fatalf("got %d diffs, want 0: %v", len(diffs), diffs)
+	}
+}
+
+func TestDiffPrimaryKeyOrderMatters(t *testing.T) {
+	a := newSchema()
+	a.Tables = []string{"memberships"}
+	a.PrimaryKey["memberships"] = []string{"org_id", "user_id"}
+
+	b := newSchema()
+	b.Tables = []string{"memberships"}
+	b.PrimaryKey["memberships"] = []string{"user_id", "org_id"}
+
+	diffs := Diff(a, b)
+	if len(diffs) != 1 {
+		t.Fatalf("got %d diffs, want 1: %v", len(diffs), diffs)
+	}
+	if diffs[0].Table != "memberships" {
+		t.Errorf("Table = %q, want %q", diffs[0].Table, "memberships")
+	}
+}
+
+func TestDiffPrimaryKeySameColumnsSameOrder(t *testing.T) {
+	a := newSchema()
+	a.Tables = []string{"memberships"}
+	a.PrimaryKey["memberships"] = []string{"org_id", "user_id"}
+
+	b := newSchema()
+	b.Tables = []string{"memberships"}
+	b.PrimaryKey["memberships"] = []string{"org_id", "user_id"}
+
+	if diffs := Diff(a, b); len(diffs) != 0 {
+		t.Fatalf("got %d diffs, want 0: %v", len(diffs), diffs)
+	}
+}
+
+func TestDiffColumnAdded(t *testing.T) {
+	a := newSchema()
+	a.Tables = []string{"users"}
+	a.Columns["users"] = []Column{{Name: "id", Type: "integer"}}
+
+	b := newSchema()
+	b.Tables = []string{"users"}
+	b.Columns["users"] = []Column{
+		{Name: "id", Type: "integer"},
+		{Name: "email", Type: "text"},
+	}
+
+	diffs := Diff(a, b)
+	if len(diffs) != 1 {
+		t.Fatalf("got %d diffs, want 1: %v", len(diffs), diffs)
+	}
+}
+
+func TestDiffColumnTypeChanged(t *testing.T) {
+	a := newSchema()
+	a.Tables = []string{"users"}
+	a.Columns["users"] = []Column{{Name: "name", Type: "character varying(10)"}}
+
+	b := newSchema()
+	b.Tables = []string{"users"}
+	b.Columns["users"] = []Column{{Name: "name", Type: "character varying(255)"}}
+
+	diffs := Diff(a, b)
+	if len(diffs) != 1 {
+		t.Fatalf("got %d diffs, want 1: %v", len(diffs), diffs)
+	}
+}
+
+func TestDiffIndexAddedAndChanged(t *testing.T) {
+	a := newSchema()
+	a.Tables = []string{"users"}
+	a.Indexes["users"] = []Index{{Name: "users_email_idx", Unique: false, Columns: []string{"email"}}}
+
+	b := newSchema()
+	b.Tables = []string{"users"}
+	b.Indexes["users"] = []Index{
+		{Name: "users_email_idx", Unique: true, Columns: []string{"email"}},
+		{Name: "users_name_idx", Unique: false, Columns: []string{"name"}},
+	}
+
+	diffs := Diff(a, b)
+	if len(diffs) != 2 {
+		t.Fatalf("got %d diffs, want 2: %v", len(diffs), diffs)
+	}
+}
+
+func TestDiffForeignKeyRemoved(t *testing.T) {
+	a := newSchema()
+	a.Tables = []string{"posts"}
+	a.ForeignKeys["posts"] = []ForeignKey{{
+		Name:              "posts_author_id_fkey",
+		Columns:           []string{"author_id"},
+		ReferencedTable:   "users",
+		ReferencedColumns: []string{"id"},
+	}}
+
+	b := newSchema()
+	b.Tables = []string{"posts"}
+
+	diffs := Diff(a, b)
+	if len(diffs) != 1 {
+		t.Fatalf("got %d diffs, want 1: %v", len(diffs), diffs)
+	}
+}
+
+func TestDiffUniqueIsSetSemantics(t *testing.T) {
+	a := newSchema()
+	a.Tables = []string{"memberships"}
+	a.Unique["memberships"] = [][]string{{"org_id", "user_id"}}
+
+	b := newSchema()
+	b.Tables = []string{"memberships"}
+	b.Unique["memberships"] = [][]string{{"user_id", "org_id"}}
+
+	if diffs := Diff(a, b); len(diffs) != 0 {
+		t.Fatalf("got %d diffs, want 0 (unique constraints are unordered sets of columns): %v", len(diffs), diffs)
+	}
+}
+
+func TestDiffTableAdded(t *testing.T) {
+	a := newSchema()
+	a.Tables = []string{"users"}
+
+	b := newSchema()
+	b.Tables = []string{"users", "posts"}
+
+	diffs := Diff(a, b)
+	if len(diffs) != 1 {
+		t.Fatalf("got %d diffs, want 1: %v", len(diffs), diffs)
+	}
+}
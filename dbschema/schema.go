@@ -0,0 +1,291 @@
+// Package dbschema introspects and compares the structure of a
+// PostgreSQL database's public schema, independent of how that
+// structure was produced. It's meant to catch migration drift: that
+// applying migrations sequentially produces the same schema as a
+// fresh snapshot.
+package dbschema
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// A Schema is a structural snapshot of a Postgres database's public
+// schema.
+type Schema struct {
+	Tables      []string
+	Columns     map[string][]Column
+	Indexes     map[string][]Index
+	ForeignKeys map[string][]ForeignKey
+	PrimaryKey  map[string][]string
+	Unique      map[string][][]string
+	Sequences   []string
+}
+
+// A Column describes one column of a table.
+type Column struct {
+	Name     string
+	Type     string
+	Nullable bool
+	Default  string
+}
+
+// An Index describes one index on a table.
+type Index struct {
+	Name    string
+	Unique  bool
+	Columns []string
+}
+
+// A ForeignKey describes one foreign key constraint on a table.
+type ForeignKey struct {
+	Name              string
+	Columns           []string
+	ReferencedTable   string
+	ReferencedColumns []string
+}
+
+// Load introspects db's public schema using information_schema and
+// pg_catalog and returns a structured Schema value.
+func Load(db *sql.DB) (*Schema, error) {
+	s := &Schema{
+		Columns:     make(map[string][]Column),
+		Indexes:     make(map[string][]Index),
+		ForeignKeys: make(map[string][]ForeignKey),
+		PrimaryKey:  make(map[string][]string),
+		Unique:      make(map[string][][]string),
+	}
+
+	loaders := []func(*sql.DB) error{
+		s.loadTables,
+		s.loadColumns,
+		s.loadIndexes,
+		s.loadForeignKeys,
+		s.loadPrimaryKeys,
+		s.loadUnique,
+		s.loadSequences,
+	}
+	for _, load := range loaders {
+		if err := load(db); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) loadTables(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = 'public' AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		s.Tables = append(s.Tables, name)
+	}
+	return rows.Err()
+}
+
+// loadColumns reads column types via pg_catalog's format_type, rather
+// than information_schema.columns' data_type, because data_type
+// collapses length/precision/scale: varchar(10) and varchar(255), or
+// numeric(10,2) and numeric, all surface as the same string. That
+// would hide exactly the class of drift Diff is meant to catch.
+func (s *Schema) loadColumns(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT
+			c.relname AS table_name,
+			a.attname AS column_name,
+			format_type(a.atttypid, a.atttypmod) AS data_type,
+			NOT a.attnotnull AS is_nullable,
+			COALESCE(pg_get_expr(ad.adbin, ad.adrelid), '') AS column_default
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		WHERE n.nspname = 'public'
+		  AND c.relkind = 'r'
+		  AND a.attnum > 0
+		  AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var col Column
+		if err := rows.Scan(&table, &col.Name, &col.Type, &col.Nullable, &col.Default); err != nil {
+			return err
+		}
+		s.Columns[table] = append(s.Columns[table], col)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) loadIndexes(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT t.relname, i.relname, ix.indisunique, array_agg(a.attname ORDER BY k.ord)
+		FROM pg_index ix
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = 'public'
+		GROUP BY t.relname, i.relname, ix.indisunique
+		ORDER BY t.relname, i.relname
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var idx Index
+		var columns []string
+		if err := rows.Scan(&table, &idx.Name, &idx.Unique, pq.Array(&columns)); err != nil {
+			return err
+		}
+		idx.Columns = columns
+		s.Indexes[table] = append(s.Indexes[table], idx)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) loadForeignKeys(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT tc.table_name, tc.constraint_name, kcu.column_name,
+		       ccu.table_name, ccu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+		    ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+		JOIN information_schema.constraint_column_usage ccu
+		    ON tc.constraint_name = ccu.constraint_name AND tc.table_schema = ccu.table_schema
+		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = 'public'
+		ORDER BY tc.table_name, tc.constraint_name, kcu.ordinal_position
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byKey := make(map[string]*ForeignKey)
+	var order []string
+	tableOf := make(map[string]string)
+	for rows.Next() {
+		var table, name, column, refTable, refColumn string
+		if err := rows.Scan(&table, &name, &column, &refTable, &refColumn); err != nil {
+			return err
+		}
+		key := table + "." + name
+		fk, ok := byKey[key]
+		if !ok {
+			fk = &ForeignKey{Name: name, ReferencedTable: refTable}
+			byKey[key] = fk
+			order = append(order, key)
+			tableOf[key] = table
+		}
+		fk.Columns = append(fk.Columns, column)
+		fk.ReferencedColumns = append(fk.ReferencedColumns, refColumn)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, key := range order {
+		table := tableOf[key]
+		s.ForeignKeys[table] = append(s.ForeignKeys[table], *byKey[key])
+	}
+	return nil
+}
+
+func (s *Schema) loadPrimaryKeys(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT tc.table_name, kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+		    ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+		WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = 'public'
+		ORDER BY tc.table_name, kcu.ordinal_position
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return err
+		}
+		s.PrimaryKey[table] = append(s.PrimaryKey[table], column)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) loadUnique(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT tc.table_name, tc.constraint_name, kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+		    ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+		WHERE tc.constraint_type = 'UNIQUE' AND tc.table_schema = 'public'
+		ORDER BY tc.table_name, tc.constraint_name, kcu.ordinal_position
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byKey := make(map[string][]string)
+	var order []string
+	tableOf := make(map[string]string)
+	for rows.Next() {
+		var table, name, column string
+		if err := rows.Scan(&table, &name, &column); err != nil {
+			return err
+		}
+		key := table + "." + name
+		if _, ok := byKey[key]; !ok {
+			order = append(order, key)
+			tableOf[key] = table
+		}
+		byKey[key] = append(byKey[key], column)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, key := range order {
+		table := tableOf[key]
+		s.Unique[table] = append(s.Unique[table], byKey[key])
+	}
+	return nil
+}
+
+func (s *Schema) loadSequences(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT sequence_name FROM information_schema.sequences
+		WHERE sequence_schema = 'public'
+		ORDER BY sequence_name
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		s.Sequences = append(s.Sequences, name)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,60 @@
+package dbschema
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/jbowens/pqtest/internal/pgurl"
+	"github.com/lib/pq"
+)
+
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// LoadFromSQLFile creates a throwaway database, applies the SQL file
+// at path to it, introspects the result with Load, then drops the
+// database. It connects using the same PGHOST, PGPORT, PGUSER,
+// PGPASSWORD, PGDATABASE and PGSSLMODE environment variables as psql,
+// falling back to postgres://localhost:5432/postgres?sslmode=disable
+// for any that are unset. It's meant
+// for comparing a fresh schema.sql snapshot against the schema
+// produced by applying migrations, to catch migration drift.
+func LoadFromSQLFile(path string) (*Schema, error) {
+	schemaSQL, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	adminURL := pgurl.FromEnv()
+	admin, err := sql.Open("postgres", adminURL)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	name := fmt.Sprintf("dbschema_%d", random.Int63())
+	if _, err := admin.Exec("CREATE DATABASE " + pq.QuoteIdentifier(name)); err != nil {
+		return nil, err
+	}
+	defer admin.Exec("DROP DATABASE " + pq.QuoteIdentifier(name))
+
+	u, err := url.Parse(adminURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + name
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(string(schemaSQL)); err != nil {
+		return nil, err
+	}
+	return Load(db)
+}
@@ -0,0 +1,85 @@
+package pqtest
+
+import (
+	"context"
+	"database/sql"
+
+	pgxv4 "github.com/jackc/pgx/v4"
+	pgxv4stdlib "github.com/jackc/pgx/v4/stdlib"
+	pgxv5 "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	pgxv5stdlib "github.com/jackc/pgx/v5/stdlib"
+)
+
+// A Driver selects the underlying client library used to connect to
+// databases created by Open. The zero value is DriverLibPQ.
+type Driver int
+
+const (
+	// DriverLibPQ connects using github.com/lib/pq, pqtest's original
+	// and default driver.
+	DriverLibPQ Driver = iota
+	// DriverPGXV4 connects using github.com/jackc/pgx/v4's database/sql
+	// driver.
+	DriverPGXV4
+	// DriverPGXV5 connects using github.com/jackc/pgx/v5's database/sql
+	// driver.
+	DriverPGXV5
+)
+
+// WithDriver returns an Option that selects the underlying driver used
+// to open connections to the test database created by Open. It has no
+// effect on the control connection used to create and garbage collect
+// databases, which always uses lib/pq.
+func WithDriver(d Driver) Option {
+	return optionFn(func(f Fataler, data *optionData) {
+		data.driver = d
+	})
+}
+
+// openDB opens dsn using the client library selected by d, returning
+// a *sql.DB in all cases so that Open's signature doesn't change
+// based on driver.
+func openDB(d Driver, dsn string) (*sql.DB, error) {
+	switch d {
+	case DriverPGXV4:
+		cfg, err := pgxv4.ParseConfig(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return pgxv4stdlib.OpenDB(*cfg), nil
+	case DriverPGXV5:
+		cfg, err := pgxv5.ParseConfig(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return pgxv5stdlib.OpenDB(*cfg), nil
+	default:
+		return sql.Open("postgres", dsn)
+	}
+}
+
+// OpenPool creates a new test PostgreSQL database like Open, but
+// returns a native *pgxpool.Pool rather than a *sql.DB. OpenPool
+// always uses pgx/v5, regardless of any WithDriver Option passed in
+// opts.
+func OpenPool(ctx context.Context, f Fataler, opts ...Option) *pgxpool.Pool {
+	data := newOptionData()
+	for _, opt := range opts {
+		opt.apply(f, &data)
+	}
+	applySchemaPaths(f, &data)
+	adminURL := resolveAdminURL(ctx, f, &data)
+
+	newDatabaseURL, name, err := mkdb(adminURL, data.driver, data.schema, data.syncGC)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	pool, err := pgxpool.New(ctx, newDatabaseURL)
+	if err != nil {
+		f.Fatal(err)
+	}
+	registerCleanup(f, &data, adminURL, pool.Close, name)
+	return pool
+}
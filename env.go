@@ -0,0 +1,25 @@
+package pqtest
+
+import "github.com/jbowens/pqtest/internal/pgurl"
+
+// DatabaseURL returns an Option that overrides the control connection
+// string Open uses to create and garbage collect test databases. It
+// replaces the default of postgres:///postgres?sslmode=disable.
+func DatabaseURL(databaseURL string) Option {
+	return optionFn(func(f Fataler, data *optionData) {
+		data.databaseURL = databaseURL
+	})
+}
+
+// FromEnv returns an Option that builds the control connection string
+// from the standard PGHOST, PGPORT, PGUSER, PGPASSWORD, PGDATABASE and
+// PGSSLMODE environment variables recognized by libpq and most
+// Postgres client tools. Variables that are unset fall back to host
+// localhost, port 5432, database postgres and sslmode disable.
+// FromEnv lets pqtest point at a CI Postgres
+// container without hardcoding a connection string.
+func FromEnv() Option {
+	return optionFn(func(f Fataler, data *optionData) {
+		data.databaseURL = pgurl.FromEnv()
+	})
+}
@@ -0,0 +1,46 @@
+// Package pgurl builds Postgres connection strings from the standard
+// PG* environment variables recognized by libpq and most Postgres
+// client tools. It's shared by pqtest and pqtest/dbschema so the two
+// don't drift out of sync with each other; dbschema can't import the
+// parent pqtest package without an import cycle, hence the small
+// internal package rather than exporting this from pqtest itself.
+package pgurl
+
+import (
+	"net/url"
+	"os"
+)
+
+// FromEnv builds a connection string from PGHOST, PGPORT, PGUSER,
+// PGPASSWORD, PGDATABASE and PGSSLMODE. Unset variables fall back to
+// host localhost, port 5432, database postgres and sslmode disable;
+// with PGUSER unset, the connection string names no user.
+func FromEnv() string {
+	host := envOrDefault("PGHOST", "localhost")
+	port := envOrDefault("PGPORT", "5432")
+
+	u := url.URL{
+		Scheme: "postgres",
+		Host:   host + ":" + port,
+		Path:   "/" + envOrDefault("PGDATABASE", "postgres"),
+	}
+	if user := os.Getenv("PGUSER"); user != "" {
+		if pass, ok := os.LookupEnv("PGPASSWORD"); ok {
+			u.User = url.UserPassword(user, pass)
+		} else {
+			u.User = url.User(user)
+		}
+	}
+
+	q := url.Values{}
+	q.Set("sslmode", envOrDefault("PGSSLMODE", "disable"))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
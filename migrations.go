@@ -0,0 +1,313 @@
+package pqtest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// OpenVersioned creates a new test database like Open, but applies
+// migrations loaded by a MigrationsVersioned Option through a
+// Migrator rather than all at once, and returns that Migrator
+// alongside the *sql.DB so tests can call MigrateTo or Down to
+// exercise migration behavior mid-test. If no MigrationsVersioned
+// Option is given, the returned Migrator has no migrations to apply:
+// Down and MigrateTo(0) change nothing, and MigrateTo of any other
+// version returns an error.
+func OpenVersioned(f Fataler, opts ...Option) (*sql.DB, *Migrator) {
+	data := newOptionData()
+	for _, opt := range opts {
+		opt.apply(f, &data)
+	}
+	applySchemaPaths(f, &data)
+	adminURL := resolveAdminURL(context.Background(), f, &data)
+
+	newDatabaseURL, name, err := mkdb(adminURL, data.driver, data.schema, data.syncGC)
+	if err != nil {
+		f.Fatal(err)
+	}
+	logURL(f, newDatabaseURL)
+	db, err := openDB(data.driver, newDatabaseURL)
+	if err != nil {
+		f.Fatal(err)
+	}
+	registerCleanup(f, &data, adminURL, func() { db.Close() }, name)
+
+	table := data.migrationsTable
+	if table == "" {
+		table = "schema_migrations"
+	}
+	m := &Migrator{db: db, table: table, files: data.migrations}
+	if len(m.files) > 0 {
+		if err := m.MigrateTo(m.files[len(m.files)-1].version); err != nil {
+			f.Fatal(err)
+		}
+	}
+	return db, m
+}
+
+// migrationFilenameRE matches the golang-migrate filename convention,
+// e.g. 0001_create_users.up.sql or 0001_create_users.down.sql.
+var migrationFilenameRE = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// A migrationFile is one numbered migration, with up and/or down SQL.
+type migrationFile struct {
+	version  int64
+	name     string
+	upPath   string
+	downPath string
+}
+
+// A MigrationOpt customizes the behavior of MigrationsVersioned.
+type MigrationOpt interface {
+	apply(*migrationsConfig)
+}
+
+type migrationsConfig struct {
+	table string
+}
+
+type migrationOptFn func(*migrationsConfig)
+
+func (f migrationOptFn) apply(c *migrationsConfig) {
+	f(c)
+}
+
+// MigrationsTable returns a MigrationOpt overriding the name of the
+// table used to record the applied migration version. The default,
+// "schema_migrations", matches golang-migrate.
+func MigrationsTable(name string) MigrationOpt {
+	return migrationOptFn(func(c *migrationsConfig) {
+		c.table = name
+	})
+}
+
+// MigrationsVersioned returns an Option that loads golang-migrate
+// compatible versioned migrations ({version}_{name}.up.sql and the
+// matching .down.sql) from dir. Unlike Migrations, only .up.sql files
+// are applied, in numeric version order, and the applied version is
+// recorded in a schema_migrations table so that a Migrator returned
+// by OpenVersioned can move the database to other versions mid-test.
+//
+// MigrationsVersioned has no effect when used with Open; use
+// OpenVersioned to get a Migrator back.
+func MigrationsVersioned(dir string, opts ...MigrationOpt) Option {
+	cfg := migrationsConfig{table: "schema_migrations"}
+	for _, o := range opts {
+		o.apply(&cfg)
+	}
+	return optionFn(func(f Fataler, data *optionData) {
+		files, err := loadMigrationFiles(dir)
+		if err != nil {
+			f.Fatal(err)
+		}
+		data.migrations = files
+		data.migrationsTable = cfg.table
+	})
+}
+
+// loadMigrationFiles reads dir non-recursively for golang-migrate
+// style migration files and returns them sorted by ascending version.
+func loadMigrationFiles(dir string) ([]migrationFile, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*migrationFile)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := migrationFilenameRE.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pqtest: invalid migration version in %q: %w", entry.Name(), err)
+		}
+		mf, ok := byVersion[version]
+		if !ok {
+			mf = &migrationFile{version: version, name: m[2]}
+			byVersion[version] = mf
+		}
+		path := filepath.Join(dir, entry.Name())
+		if m[3] == "up" {
+			mf.upPath = path
+		} else {
+			mf.downPath = path
+		}
+	}
+
+	files := make([]migrationFile, 0, len(byVersion))
+	for _, mf := range byVersion {
+		files = append(files, *mf)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].version < files[j].version })
+	return files, nil
+}
+
+// A Migrator applies golang-migrate compatible versioned migrations
+// to a database created by OpenVersioned, recording the currently
+// applied version in a schema_migrations table.
+type Migrator struct {
+	db    *sql.DB
+	table string
+	files []migrationFile
+}
+
+// MigrateTo applies or rolls back migrations until the database is at
+// exactly the given version. A version of 0 rolls back every
+// migration. It's an error to request a version that doesn't match
+// any loaded migration file.
+func (m *Migrator) MigrateTo(version int64) error {
+	if version != 0 && !m.hasVersion(version) {
+		return fmt.Errorf("pqtest: no migration with version %d", version)
+	}
+
+	if err := m.ensureVersionsTable(); err != nil {
+		return err
+	}
+	current, err := m.currentVersion()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version > current:
+		for _, mf := range m.files {
+			if mf.version <= current || mf.version > version {
+				continue
+			}
+			if err := m.applyUp(mf); err != nil {
+				return err
+			}
+			current = mf.version
+		}
+	case version < current:
+		for i := len(m.files) - 1; i >= 0; i-- {
+			mf := m.files[i]
+			if mf.version > current || mf.version <= version {
+				continue
+			}
+			if err := m.applyDown(mf); err != nil {
+				return err
+			}
+			current = m.versionBefore(mf.version)
+		}
+	}
+	return nil
+}
+
+// Down rolls back the given number of applied migration steps.
+func (m *Migrator) Down(steps int) error {
+	if err := m.ensureVersionsTable(); err != nil {
+		return err
+	}
+	current, err := m.currentVersion()
+	if err != nil {
+		return err
+	}
+	return m.MigrateTo(downTarget(m.files, current, steps))
+}
+
+// downTarget returns the version MigrateTo should move to in order to
+// roll back steps applied migrations from current, given files sorted
+// by ascending version. Rolling back past the first migration, or
+// calling Down when no migration is currently applied, targets
+// version 0 (no migrations applied).
+func downTarget(files []migrationFile, current int64, steps int) int64 {
+	idx := -1
+	for i, mf := range files {
+		if mf.version == current {
+			idx = i
+			break
+		}
+	}
+	target := idx - steps
+	if target < 0 {
+		return 0
+	}
+	return files[target].version
+}
+
+func (m *Migrator) hasVersion(version int64) bool {
+	for _, mf := range m.files {
+		if mf.version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Migrator) versionBefore(version int64) int64 {
+	var prev int64
+	for _, mf := range m.files {
+		if mf.version >= version {
+			break
+		}
+		prev = mf.version
+	}
+	return prev
+}
+
+func (m *Migrator) ensureVersionsTable() error {
+	_, err := m.db.Exec(fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s (version bigint NOT NULL, dirty boolean NOT NULL DEFAULT false)`,
+		m.table,
+	))
+	return err
+}
+
+func (m *Migrator) currentVersion() (int64, error) {
+	var version int64
+	err := m.db.QueryRow(fmt.Sprintf(`SELECT version FROM %s LIMIT 1`, m.table)).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+func (m *Migrator) applyUp(mf migrationFile) error {
+	if mf.upPath == "" {
+		return fmt.Errorf("pqtest: no up migration for version %d", mf.version)
+	}
+	return m.apply(mf.upPath, mf.version)
+}
+
+func (m *Migrator) applyDown(mf migrationFile) error {
+	if mf.downPath == "" {
+		return fmt.Errorf("pqtest: no down migration for version %d", mf.version)
+	}
+	return m.apply(mf.downPath, m.versionBefore(mf.version))
+}
+
+func (m *Migrator) apply(path string, newVersion int64) error {
+	sqlBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(string(sqlBytes)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s`, m.table)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (version) VALUES ($1)`, m.table), newVersion); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,166 @@
+package pqtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeMigrationFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("-- "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadMigrationFilesOrdersNumerically(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pqtest-migrations-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Lexicographic order would put "10_..." before "2_...".
+	writeMigrationFiles(t, dir,
+		"10_add_widgets.up.sql",
+		"2_add_users.up.sql",
+		"1_create_schema.up.sql",
+	)
+
+	files, err := loadMigrationFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want 3", len(files))
+	}
+	wantVersions := []int64{1, 2, 10}
+	for i, want := range wantVersions {
+		if files[i].version != want {
+			t.Errorf("files[%d].version = %d, want %d", i, files[i].version, want)
+		}
+	}
+}
+
+func TestLoadMigrationFilesPairsUpAndDown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pqtest-migrations-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeMigrationFiles(t, dir,
+		"1_create_users.up.sql",
+		"1_create_users.down.sql",
+		"2_add_index.up.sql", // no corresponding down file
+	)
+
+	files, err := loadMigrationFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	if files[0].upPath == "" || files[0].downPath == "" {
+		t.Errorf("version 1: got upPath=%q downPath=%q, want both set", files[0].upPath, files[0].downPath)
+	}
+	if files[1].upPath == "" {
+		t.Errorf("version 2: got empty upPath")
+	}
+	if files[1].downPath != "" {
+		t.Errorf("version 2: got downPath=%q, want empty", files[1].downPath)
+	}
+}
+
+func TestLoadMigrationFilesIgnoresNonMatchingNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pqtest-migrations-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeMigrationFiles(t, dir,
+		"README.md",
+		"schema.sql",
+		"1_create_users.up.sql",
+	)
+
+	files, err := loadMigrationFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+	if files[0].version != 1 {
+		t.Errorf("version = %d, want 1", files[0].version)
+	}
+}
+
+func TestDownTarget(t *testing.T) {
+	files := []migrationFile{{version: 1}, {version: 2}, {version: 3}}
+
+	tests := []struct {
+		name    string
+		current int64
+		steps   int
+		want    int64
+	}{
+		{"one step back from latest", 3, 1, 2},
+		{"two steps back from latest", 3, 2, 1},
+		{"rolls back past the first migration", 2, 5, 0},
+		{"zero steps is a no-op", 2, 0, 2},
+		{"no migration currently applied", 0, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := downTarget(files, tt.current, tt.steps)
+			if got != tt.want {
+				t.Errorf("downTarget(files, %d, %d) = %d, want %d", tt.current, tt.steps, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigratorHasVersion(t *testing.T) {
+	m := &Migrator{files: []migrationFile{{version: 1}, {version: 2}, {version: 5}}}
+
+	tests := []struct {
+		version int64
+		want    bool
+	}{
+		{0, false},
+		{1, true},
+		{3, false},
+		{5, true},
+	}
+	for _, tt := range tests {
+		if got := m.hasVersion(tt.version); got != tt.want {
+			t.Errorf("hasVersion(%d) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestMigratorVersionBefore(t *testing.T) {
+	m := &Migrator{files: []migrationFile{{version: 1}, {version: 2}, {version: 5}}}
+
+	tests := []struct {
+		version int64
+		want    int64
+	}{
+		{1, 0},
+		{2, 1},
+		{5, 2},
+		{10, 5},
+	}
+	for _, tt := range tests {
+		if got := m.versionBefore(tt.version); got != tt.want {
+			t.Errorf("versionBefore(%d) = %d, want %d", tt.version, got, tt.want)
+		}
+	}
+}
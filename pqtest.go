@@ -1,8 +1,8 @@
 package pqtest
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/url"
@@ -33,9 +33,23 @@ type Option interface {
 }
 
 type optionData struct {
-	schema      []string
-	schemaPaths []string
-	databaseURL string
+	schema          []string
+	schemaPaths     []string
+	databaseURL     string
+	driver          Driver
+	migrations      []migrationFile
+	migrationsTable string
+	keepOnFailure   bool
+	syncGC          bool
+	backend         Backend
+}
+
+// newOptionData returns the default optionData shared by Open,
+// OpenPool and OpenVersioned before any Option is applied.
+func newOptionData() optionData {
+	return optionData{
+		databaseURL: "postgres:///postgres?sslmode=disable",
+	}
 }
 
 type optionFn func(Fataler, *optionData)
@@ -74,68 +88,92 @@ func Migrations(dir string) Option {
 }
 
 // Open creates a new test PostgreSQL database, returning
-// a *sql.DB opened to the database.
+// a *sql.DB opened to the database. By default the returned *sql.DB
+// uses lib/pq; pass a WithDriver Option to use pgx/v4 or pgx/v5
+// instead, or call OpenPool for a native pgx connection pool.
 //
-// Databases created by pqtest are garbage collected by
+// If f implements Cleanup(func()), as *testing.T and *testing.B do,
+// Open registers a cleanup that drops the database when the test
+// finishes, rather than relying solely on the background garbage
+// collector. Pass KeepOnFailure to keep the database around for
+// inspection when the test fails, and SyncGC to wait for drops to
+// complete rather than firing them in background goroutines.
+//
+// Databases created by pqtest are also garbage collected by
 // subsequent calls to pqtest.Open.
 func Open(f Fataler, opts ...Option) *sql.DB {
-	data := optionData{
-		databaseURL: "postgres:///postgres?sslmode=disable",
-	}
+	data := newOptionData()
 	for _, opt := range opts {
 		opt.apply(f, &data)
 	}
+	applySchemaPaths(f, &data)
+	adminURL := resolveAdminURL(context.Background(), f, &data)
 
-	for _, sp := range data.schemaPaths {
-		schemaBytes, err := ioutil.ReadFile(sp)
-		if err != nil {
-			f.Fatal(sp, err)
-		}
-		data.schema = append(data.schema, string(schemaBytes))
-	}
-
-	newDatabaseURL, err := mkdb(data.databaseURL)
+	newDatabaseURL, name, err := mkdb(adminURL, data.driver, data.schema, data.syncGC)
 	if err != nil {
 		f.Fatal(err)
 	}
-	fmt.Println(newDatabaseURL)
-	db, err := sql.Open("postgres", newDatabaseURL)
+	logURL(f, newDatabaseURL)
+	db, err := openDB(data.driver, newDatabaseURL)
 	if err != nil {
 		f.Fatal(err)
 	}
-	for _, schema := range data.schema {
-		_, err = db.Exec(schema)
+	registerCleanup(f, &data, adminURL, func() { db.Close() }, name)
+	return db
+}
+
+// applySchemaPaths reads each path in data.schemaPaths and appends its
+// contents to data.schema, so that Open and OpenPool share the same
+// schema-loading behavior.
+func applySchemaPaths(f Fataler, data *optionData) {
+	for _, sp := range data.schemaPaths {
+		schemaBytes, err := ioutil.ReadFile(sp)
 		if err != nil {
-			f.Fatal(err)
+			f.Fatal(sp, err)
 		}
+		data.schema = append(data.schema, string(schemaBytes))
 	}
-	return db
 }
 
-func mkdb(dbURL string) (string, error) {
+// mkdb creates a new, randomly-named database on the Postgres server
+// at dbURL and returns a connection string pointed at it along with
+// its bare name. If schema is non-empty, the new database is created
+// as a copy of a cached template database for that schema (see
+// template.go) instead of being left empty, so callers no longer
+// need to replay schema SQL themselves.
+func mkdb(dbURL string, driver Driver, schema []string, syncGC bool) (string, string, error) {
 	_, file, _, _ := runtime.Caller(2)
 
 	name := randomDBName(file)
 	u, err := url.Parse(dbURL)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	u.Path = "/" + name
 	u.RawPath = "/" + name
 
 	ctldb, err := sql.Open("postgres", dbURL)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	defer ctldb.Close()
 
-	err = garbageCollectDBs(ctldb)
+	err = garbageCollectDBs(ctldb, syncGC)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	_, err = ctldb.Exec("CREATE DATABASE " + pq.QuoteIdentifier(name))
-	return u.String(), err
+	createStmt := "CREATE DATABASE " + pq.QuoteIdentifier(name)
+	if len(schema) > 0 {
+		tmplName, err := ensureTemplateDB(ctldb, driver, dbURL, schema)
+		if err != nil {
+			return "", "", err
+		}
+		createStmt += " TEMPLATE " + pq.QuoteIdentifier(tmplName)
+	}
+
+	_, err = ctldb.Exec(createStmt)
+	return u.String(), name, err
 }
 
 func randomDBName(file string) (dbname string) {
@@ -157,12 +195,17 @@ func formatDBName(suffix string, t time.Time) string {
 	return dbname
 }
 
-func garbageCollectDBs(db *sql.DB) error {
+// garbageCollectDBs drops databases created by pqtest more than
+// gcDur ago. By default it fires each DROP DATABASE in its own
+// goroutine so callers aren't slowed down; pass sync to wait for
+// every drop to complete instead, which avoids leaking databases
+// when the test process exits before a background drop finishes.
+func garbageCollectDBs(db *sql.DB, sync bool) error {
 	const gcDur = 3 * time.Minute
 	gcTime := time.Now().Add(-gcDur)
 	const q = `
 		SELECT datname FROM pg_database
-		WHERE datname LIKE 'pqtest_%' AND datname < $1
+		WHERE datname LIKE 'pqtest_%' AND datname NOT LIKE 'pqtest_tmpl_%' AND datname < $1
 	`
 	rows, err := db.Query(q, formatDBName("db", gcTime))
 	if err != nil {
@@ -184,6 +227,12 @@ func garbageCollectDBs(db *sql.DB) error {
 		if i > 5 {
 			break // drop up to five databases per test
 		}
+		if sync {
+			if _, err := db.Exec("DROP DATABASE " + pq.QuoteIdentifier(name)); err != nil {
+				return err
+			}
+			continue
+		}
 		go db.Exec("DROP DATABASE " + pq.QuoteIdentifier(name))
 	}
 	return nil
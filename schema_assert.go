@@ -0,0 +1,32 @@
+package pqtest
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jbowens/pqtest/dbschema"
+)
+
+// AssertSchemaMatches introspects db's current schema and fails f,
+// printing a human-readable diff, if it doesn't structurally match
+// expected. It's meant to catch migration drift: pair it with
+// dbschema.LoadFromSQLFile to assert that applying migrations
+// sequentially produces the same schema as a fresh schema.sql
+// snapshot.
+func AssertSchemaMatches(f Fataler, db *sql.DB, expected *dbschema.Schema) {
+	actual, err := dbschema.Load(db)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	diffs := dbschema.Diff(expected, actual)
+	if len(diffs) == 0 {
+		return
+	}
+
+	msg := fmt.Sprintf("pqtest: schema does not match expected (%d difference(s)):", len(diffs))
+	for _, d := range diffs {
+		msg += "\n  " + d.String()
+	}
+	f.Fatal(msg)
+}
@@ -0,0 +1,137 @@
+package pqtest
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"net/url"
+
+	"github.com/lib/pq"
+)
+
+// templateDBPrefix marks databases pqtest uses to cache a schema so
+// that subsequent Open calls for the same schema can clone it with
+// CREATE DATABASE ... TEMPLATE instead of replaying schema SQL.
+// garbageCollectDBs never removes databases with this prefix.
+const templateDBPrefix = "pqtest_tmpl_"
+
+// ensureTemplateDB returns the name of a template database with
+// schema applied, creating it first if this is the first time schema
+// has been seen. ctldb is the control connection also used to create
+// and garbage collect regular test databases; dbURL is the connection
+// string used to reach it. Concurrent callers, including those in
+// other test binaries, race to build the same template database; a
+// transaction-scoped advisory lock keyed on the schema fingerprint
+// ensures only one of them actually does the work.
+func ensureTemplateDB(ctldb *sql.DB, driver Driver, dbURL string, schema []string) (string, error) {
+	fingerprint := schemaFingerprint(schema)
+	name := templateDBPrefix + fingerprint
+
+	tx, err := ctldb.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", advisoryLockID(fingerprint)); err != nil {
+		return "", err
+	}
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", name).Scan(&exists)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		if err := buildTemplateDB(ctldb, driver, dbURL, name, schema); err != nil {
+			return "", err
+		}
+	}
+
+	return name, tx.Commit()
+}
+
+// buildTemplateDB builds the template database named name, applying
+// schema to it. The build happens under a staging name and is only
+// made visible under name, via ALTER DATABASE ... RENAME TO, once
+// every schema statement has succeeded. Without this, a schema
+// statement failing - or the process being killed - partway through
+// would leave a committed-but-incomplete database visible under name
+// itself; ensureTemplateDB's existence check would then find it,
+// skip rebuilding it, and every later Open would silently clone a
+// template missing tables. Any staging database left over from a
+// previous, interrupted build attempt is dropped before a new one
+// starts.
+func buildTemplateDB(ctldb *sql.DB, driver Driver, dbURL, name string, schema []string) error {
+	staging := name + "_building"
+
+	if _, err := ctldb.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(staging)); err != nil {
+		return err
+	}
+	if _, err := ctldb.Exec("CREATE DATABASE " + pq.QuoteIdentifier(staging)); err != nil {
+		return err
+	}
+
+	if err := applySchema(driver, dbURL, staging, schema); err != nil {
+		ctldb.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(staging))
+		return err
+	}
+
+	if _, err := ctldb.Exec("ALTER DATABASE " + pq.QuoteIdentifier(staging) + " RENAME TO " + pq.QuoteIdentifier(name)); err != nil {
+		ctldb.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(staging))
+		return err
+	}
+	return nil
+}
+
+// applySchema opens the database named name on dbURL's server using
+// driver and executes each statement in schema against it in order.
+func applySchema(driver Driver, dbURL, name string, schema []string) error {
+	targetURL, err := withDBName(dbURL, name)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(driver, targetURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, s := range schema {
+		if _, err := db.Exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaFingerprint hashes the concatenated contents of schema so
+// that identical schemas, including across parallel test binaries,
+// map to the same template database name.
+func schemaFingerprint(schema []string) string {
+	h := sha256.New()
+	for _, s := range schema {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// advisoryLockID derives a Postgres advisory lock id from a schema
+// fingerprint produced by schemaFingerprint.
+func advisoryLockID(fingerprint string) int64 {
+	b, _ := hex.DecodeString(fingerprint[:16])
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// withDBName returns dbURL with its path replaced by name.
+func withDBName(dbURL, name string) (string, error) {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = "/" + name
+	u.RawPath = "/" + name
+	return u.String(), nil
+}